@@ -0,0 +1,11 @@
+package ffi
+
+import "testing"
+
+func TestAddrNotSettable(t *testing.T) {
+	v := ValueOf(int32(0))
+	a := v.Addr()
+	if a.CanSet() {
+		t.Fatal("Addr().CanSet() should be false, matching reflect.Value.Addr()")
+	}
+}
@@ -0,0 +1,208 @@
+package ffi
+
+import (
+	"math"
+	"unsafe"
+)
+
+// visit identifies a pair of pointers already compared during a
+// DeepEqual traversal, so that cycles terminate. Both sides of the pair
+// are needed: a given a-pointer can legitimately recur against more than
+// one distinct b-pointer in the same traversal (e.g. two fields of a
+// point at the same a-node but different b-nodes), and keying on a alone
+// would short-circuit the second comparison as "already seen".
+type visit struct {
+	typ  Type
+	aptr unsafe.Pointer
+	bptr unsafe.Pointer
+}
+
+// hvisit identifies a pointer on the path a Hash traversal is currently
+// walking, so that cycles through Ptr fields terminate. It is removed
+// again once the pointer's target has been hashed, so a target reached
+// through two different pointers is hashed in full both times, just as
+// DeepEqual compares it both times.
+type hvisit struct {
+	typ Type
+	ptr unsafe.Pointer
+}
+
+// DeepEqual reports whether a and b are deeply equal, recursing into
+// structs and arrays/slices field-by-field rather than comparing raw
+// bytes (Value.Buffer() exposes uninitialized struct padding, so a
+// memcmp would be unsound). Pointer cycles are broken with a visited set
+// keyed on both sides of the pair; two nil pointers are equal. As with
+// reflect.DeepEqual, values of different types are never equal, and
+// numeric kinds compare by value rather than bit pattern (+0.0 == -0.0,
+// NaN != NaN).
+func DeepEqual(a, b Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if !typeIdentical(a.typ, b.typ) {
+		return false
+	}
+	return deepValueEqual(a, b, make(map[visit]bool))
+}
+
+func deepValueEqual(a, b Value, visited map[visit]bool) bool {
+	switch a.Kind() {
+	case Bool:
+		return a.Bool() == b.Bool()
+	case Int, Int8, Int16, Int32, Int64:
+		return a.Int() == b.Int()
+	case Uint, Uint8, Uint16, Uint32, Uint64, Uintptr:
+		return a.Uint() == b.Uint()
+	case Float, Double:
+		return a.Float() == b.Float()
+	case Complex64, Complex128:
+		return a.Complex() == b.Complex()
+	case String:
+		return a.String() == b.String()
+	case Ptr:
+		aNil, bNil := a.IsNil(), b.IsNil()
+		if aNil || bNil {
+			return aNil == bNil
+		}
+		key := visit{a.typ, *(*unsafe.Pointer)(a.val), *(*unsafe.Pointer)(b.val)}
+		if visited[key] {
+			return true
+		}
+		visited[key] = true
+		return deepValueEqual(a.Elem(), b.Elem(), visited)
+	case Array:
+		for i := 0; i < a.Len(); i++ {
+			if !deepValueEqual(a.Index(i), b.Index(i), visited) {
+				return false
+			}
+		}
+		return true
+	case Slice:
+		ah, bh := (*sliceHeader)(a.val), (*sliceHeader)(b.val)
+		if (ah.Data == nil) != (bh.Data == nil) {
+			return false
+		}
+		if ah.Len != bh.Len {
+			return false
+		}
+		for i := 0; i < int(ah.Len); i++ {
+			if !deepValueEqual(a.Index(i), b.Index(i), visited) {
+				return false
+			}
+		}
+		return true
+	case Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !deepValueEqual(a.Field(i), b.Field(i), visited) {
+				return false
+			}
+		}
+		return true
+	case Func:
+		// Unlike reflect.DeepEqual, a Func here is a real native function
+		// pointer, so two non-nil Funcs pointing at the same native
+		// function are equal.
+		return *(*unsafe.Pointer)(a.val) == *(*unsafe.Pointer)(b.val)
+	}
+	panic(&ValueError{"ffi.DeepEqual", a.Kind()})
+}
+
+// FNV-1a constants, used to fold each traversed field into Hash's
+// running state.
+const (
+	hashOffset64 uint64 = 14695981039346656037
+	hashPrime64  uint64 = 1099511628211
+)
+
+func hashByte(h *uint64, b byte) {
+	*h ^= uint64(b)
+	*h *= hashPrime64
+}
+
+func hashBytes(h *uint64, buf []byte) {
+	for _, b := range buf {
+		hashByte(h, b)
+	}
+}
+
+func hashUint64(h *uint64, x uint64) {
+	var buf [8]byte
+	for i := range buf {
+		buf[i] = byte(x >> (8 * i))
+	}
+	hashBytes(h, buf[:])
+}
+
+// Hash returns a hash of v's value seeded with seed, walking the same
+// fields DeepEqual compares: DeepEqual(a, b) implies Hash(a, s) ==
+// Hash(b, s) for any s.
+func Hash(v Value, seed uint64) uint64 {
+	h := seed ^ hashOffset64
+	hashValue(v, &h, make(map[hvisit]bool))
+	return h
+}
+
+func hashValue(v Value, h *uint64, visited map[hvisit]bool) {
+	switch v.Kind() {
+	case Bool:
+		if v.Bool() {
+			hashByte(h, 1)
+		} else {
+			hashByte(h, 0)
+		}
+	case Int, Int8, Int16, Int32, Int64:
+		hashUint64(h, uint64(v.Int()))
+	case Uint, Uint8, Uint16, Uint32, Uint64, Uintptr:
+		hashUint64(h, v.Uint())
+	case Float, Double:
+		f := v.Float()
+		if f == 0 {
+			f = 0 // fold -0.0 into +0.0 so Hash agrees with DeepEqual's +0.0 == -0.0
+		}
+		hashUint64(h, math.Float64bits(f))
+	case Complex64, Complex128:
+		c := v.Complex()
+		re, im := real(c), imag(c)
+		if re == 0 {
+			re = 0 // fold -0.0 into +0.0, as for Float and Double above
+		}
+		if im == 0 {
+			im = 0
+		}
+		hashUint64(h, math.Float64bits(re))
+		hashUint64(h, math.Float64bits(im))
+	case String:
+		hashBytes(h, []byte(v.String()))
+	case Ptr:
+		if v.IsNil() {
+			hashByte(h, 0)
+			return
+		}
+		key := hvisit{v.typ, v.val}
+		if visited[key] {
+			hashByte(h, 1)
+			return
+		}
+		visited[key] = true
+		hashValue(v.Elem(), h, visited)
+		delete(visited, key)
+	case Array:
+		for i := 0; i < v.Len(); i++ {
+			hashValue(v.Index(i), h, visited)
+		}
+	case Slice:
+		hdr := (*sliceHeader)(v.val)
+		hashUint64(h, uint64(hdr.Len))
+		for i := 0; i < v.Len(); i++ {
+			hashValue(v.Index(i), h, visited)
+		}
+	case Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hashValue(v.Field(i), h, visited)
+		}
+	case Func:
+		hashUint64(h, uint64(uintptr(*(*unsafe.Pointer)(v.val))))
+	default:
+		panic(&ValueError{"ffi.Hash", v.Kind()})
+	}
+}
@@ -0,0 +1,45 @@
+package ffi
+
+import "testing"
+
+type dqPair struct {
+	First  *int32
+	Second *int32
+}
+
+// TestDeepEqualVisitedKeyIncludesBothSides guards against a regression
+// where the Ptr visited-set was keyed on a's address alone: a repeated
+// a-side pointer would then be reported "already seen" against a second,
+// distinct b-side pointer without ever comparing what it points to.
+func TestDeepEqualVisitedKeyIncludesBothSides(t *testing.T) {
+	x := int32(1)
+	a := dqPair{First: &x, Second: &x}
+
+	y1, y2 := int32(1), int32(99)
+	b := dqPair{First: &y1, Second: &y2}
+
+	if DeepEqual(ValueOf(a), ValueOf(b)) {
+		t.Fatal("DeepEqual treated a.Second as already visited because a.First shares its address, without comparing b.Second")
+	}
+}
+
+func TestDeepEqualMismatchedTypesReturnFalse(t *testing.T) {
+	a := ValueOf(int32(1))
+	b := ValueOf(int64(1))
+
+	if DeepEqual(a, b) {
+		t.Fatal("DeepEqual reported values of different types as equal")
+	}
+}
+
+func TestHashAgreesWithDeepEqual(t *testing.T) {
+	a := ValueOf(dqPair{})
+	b := ValueOf(dqPair{})
+
+	if !DeepEqual(a, b) {
+		t.Fatal("expected equal values")
+	}
+	if Hash(a, 0) != Hash(b, 0) {
+		t.Fatal("Hash disagreed with DeepEqual for equal values")
+	}
+}
@@ -0,0 +1,33 @@
+package ffi
+
+import "testing"
+
+// TestFieldByNameThroughAnonymousMember guards against a regression
+// where nameIndexFor only indexed direct top-level fields, so a name
+// promoted through a C anonymous struct member (empty Name) -- which
+// VisibleFields already enumerates -- came back as the zero Value.
+func TestFieldByNameThroughAnonymousMember(t *testing.T) {
+	inner, err := NewStructType([]StructField{
+		{Name: "X", Type: int32Type, Offset: 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer, err := NewStructType([]StructField{
+		{Name: "", Type: inner, Offset: 0},
+		{Name: "Y", Type: int32Type, Offset: inner.Size()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := New(outer)
+	x := v.FieldByName("X")
+	if !x.IsValid() {
+		t.Fatal("FieldByName did not find a field promoted through an anonymous struct member")
+	}
+	x.SetInt(1)
+	if v.FieldByName("X").Int() != 1 {
+		t.Fatalf("got %d, want 1", v.FieldByName("X").Int())
+	}
+}
@@ -0,0 +1,186 @@
+package ffi
+
+/*
+#cgo LDFLAGS: -lffi
+#include <ffi.h>
+#include <stdlib.h>
+
+extern void goClosureTrampoline(ffi_cif *cif, void *ret, void **args, void *user_data);
+*/
+import "C"
+
+import (
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+)
+
+// Call calls the native function v with the given arguments and returns
+// its results, mirroring reflect.Value.Call. It panics if v's Kind is
+// not Func or len(in) does not match the function's arity.
+//
+// Call is a thin wrapper over ffi_call, using the ffi_cif stored in v's
+// Type to describe the native calling convention.
+func (v Value) Call(in []Value) []Value {
+	v.mustBe(Func)
+	tt := v.typ.(cffi_func)
+
+	if len(in) != tt.NumIn() {
+		panic("ffi: Call: wrong number of input arguments")
+	}
+
+	// ffi_call's argv must be a void** it can dereference directly. A Go
+	// slice holding Go pointers (each a.val points into Go memory) can't
+	// be passed to C itself -- that's a Go pointer to Go memory that
+	// contains Go pointers, which cgo's pointer checks reject -- so the
+	// array is allocated in C memory instead and freed after the call.
+	var argvp *unsafe.Pointer
+	if len(in) > 0 {
+		argv := (*[1 << 30]unsafe.Pointer)(C.malloc(C.size_t(len(in)) * C.size_t(unsafe.Sizeof(argvp))))[:len(in):len(in)]
+		defer C.free(unsafe.Pointer(&argv[0]))
+		for i, a := range in {
+			argv[i] = a.val
+		}
+		argvp = &argv[0]
+	}
+
+	fn := *(*unsafe.Pointer)(v.val)
+
+	var out []Value
+	var retPtr unsafe.Pointer
+	if tt.NumOut() == 1 {
+		r := New(tt.Out(0))
+		retPtr = r.val
+		out = []Value{r}
+	}
+
+	C.ffi_call((*C.ffi_cif)(tt.cif()), (*[0]byte)(fn), retPtr, argvp)
+	return out
+}
+
+// closure holds the Go-side state of a native function pointer created
+// by MakeFunc: the libffi closure backing it, the cgo.Handle identifying
+// it to the trampoline, and the callback it dispatches to.
+type closure struct {
+	ffic   *C.ffi_closure
+	handle cgo.Handle
+	typ    Type
+	fn     func(args []Value) []Value
+}
+
+// closures maps each executable trampoline pointer handed to native
+// code back to its closure, so Release can find the libffi closure and
+// the cgo.Handle from the code pointer alone. The closure (and the Go
+// callback it dispatches to) is kept alive by its cgo.Handle, which
+// Release deletes.
+var closures = struct {
+	sync.Mutex
+	m map[unsafe.Pointer]*closure
+}{m: make(map[unsafe.Pointer]*closure)}
+
+// MakeFunc returns a new Value of the given Func type backed by an
+// executable libffi closure: calling it from native code invokes fn and
+// copies its result into the native return slot. It mirrors
+// reflect.MakeFunc for a native ABI.
+//
+// The closure must be freed with Release once it is no longer needed.
+func MakeFunc(typ Type, fn func(args []Value) []Value) Value {
+	if typ.Kind() != Func {
+		panic(&ValueError{"ffi.MakeFunc", typ.Kind()})
+	}
+	tt := typ.(cffi_func)
+
+	var code unsafe.Pointer
+	ffic := (*C.ffi_closure)(C.ffi_closure_alloc(C.size_t(unsafe.Sizeof(C.ffi_closure{})), &code))
+	if ffic == nil {
+		panic("ffi: MakeFunc: ffi_closure_alloc failed")
+	}
+
+	c := &closure{ffic: ffic, typ: typ, fn: fn}
+	// C keeps user_data for the lifetime of the closure, well past this
+	// call's return, so we can't hand it a raw Go pointer (the cgo rules
+	// forbid C from retaining one). A cgo.Handle is an opaque integer
+	// token that's safe to store in C memory instead.
+	c.handle = cgo.NewHandle(c)
+	closures.Lock()
+	closures.m[code] = c
+	closures.Unlock()
+
+	status := C.ffi_prep_closure_loc(
+		ffic,
+		(*C.ffi_cif)(tt.cif()),
+		(*[0]byte)(C.goClosureTrampoline),
+		unsafe.Pointer(uintptr(c.handle)),
+		code,
+	)
+	if status != C.FFI_OK {
+		closures.Lock()
+		delete(closures.m, code)
+		closures.Unlock()
+		c.handle.Delete()
+		C.ffi_closure_free(unsafe.Pointer(ffic))
+		panic("ffi: MakeFunc: ffi_prep_closure_loc failed")
+	}
+
+	v := New(typ)
+	*(*unsafe.Pointer)(v.val) = code
+	return v
+}
+
+// Release frees the native closure backing a Value returned by
+// MakeFunc. It panics if v's Kind is not Func or v was not created by
+// MakeFunc. Once released, the function pointer must not be called
+// again.
+func (v Value) Release() {
+	v.mustBe(Func)
+	code := *(*unsafe.Pointer)(v.val)
+
+	closures.Lock()
+	c, ok := closures.m[code]
+	if ok {
+		delete(closures.m, code)
+	}
+	closures.Unlock()
+
+	if !ok {
+		panic("ffi: Release: not a MakeFunc Value")
+	}
+	c.handle.Delete()
+	C.ffi_closure_free(unsafe.Pointer(c.ffic))
+}
+
+// goClosureTrampoline is invoked directly by libffi with no Go frame
+// above it, so a panic in c.fn (or a bug here) must not escape: there is
+// nothing above us to recover it, and it would take the whole process
+// down instead of surfacing as an ordinary Go panic. On panic, the
+// return slot is left zeroed.
+//
+//export goClosureTrampoline
+func goClosureTrampoline(cif *C.ffi_cif, ret unsafe.Pointer, args *unsafe.Pointer, userdata unsafe.Pointer) {
+	defer func() { recover() }()
+
+	c := cgo.Handle(uintptr(userdata)).Value().(*closure)
+	tt := c.typ.(cffi_func)
+
+	if tt.NumOut() == 1 && ret != nil {
+		zero := unsafe.Slice((*byte)(ret), int(tt.Out(0).Size()))
+		for i := range zero {
+			zero[i] = 0
+		}
+	}
+
+	nin := tt.NumIn()
+	argv := unsafe.Slice(args, nin)
+	in := make([]Value, nin)
+	for i := 0; i < nin; i++ {
+		in[i] = Value{typ: tt.In(i), val: argv[i]}
+	}
+
+	out := c.fn(in)
+	if tt.NumOut() == 1 && ret != nil && len(out) == 1 {
+		n := int(tt.Out(0).Size())
+		dst := unsafe.Slice((*byte)(ret), n)
+		src := unsafe.Slice((*byte)(out[0].val), n)
+		copy(dst, src)
+	}
+}
@@ -0,0 +1,30 @@
+package ffi
+
+import "testing"
+
+type dqOnefield struct {
+	X int32
+}
+
+// TestSetConvertDeepEqualOnStructs guards against a regression where
+// comparing struct Types with == (or using one as a map key) panicked,
+// because a cffi_struct's field list makes its underlying representation
+// uncomparable. Set, Convert, DeepEqual, and nameIndexFor must all
+// compare type identity without relying on ==.
+func TestSetConvertDeepEqualOnStructs(t *testing.T) {
+	a := ValueOf(dqOnefield{X: 1})
+	b := New(a.Type())
+	b.Set(a)
+	if b.FieldByName("X").Int() != 1 {
+		t.Fatal("Set did not copy a struct-kind value")
+	}
+
+	c := a.Convert(a.Type())
+	if c.FieldByName("X").Int() != 1 {
+		t.Fatal("Convert's v.typ == t fast path broke on a struct-kind value")
+	}
+
+	if !DeepEqual(ValueOf(dqOnefield{X: 1}), ValueOf(dqOnefield{X: 1})) {
+		t.Fatal("DeepEqual reported equal structs as unequal")
+	}
+}
@@ -3,6 +3,8 @@ package ffi
 import (
 	"reflect"
 	"runtime"
+	"strconv"
+	"sync"
 	"unsafe"
 )
 
@@ -55,7 +57,7 @@ type Value struct {
 	// The remaining 23+ bits give a method number for method values.
 	// If flag.kind() != Func, code can assume that flagMethod is unset.
 	// If typ.size > ptrSize, code can assume that flagIndir is set.
-	//flag
+	flag flag
 }
 
 type flag uintptr
@@ -73,17 +75,30 @@ func (f flag) kind() Kind {
 	return Kind((f >> flagKindShift) & flagKindMask)
 }
 
+// kindFlag returns the flag bits identifying a freshly addressable,
+// settable, indirect Value of the given kind.
+func kindFlag(k Kind) flag {
+	return flag(k)<<flagKindShift | flagIndir | flagAddr
+}
+
 // New returns a Value representing a pointer to a new zero value for
 // the specified type.
 func New(typ Type) Value {
 	if typ == nil {
 		panic("ffi: New(nil)")
 	}
-	buf := make([]byte, int(typ.Size()))
-	ptr := unsafe.Pointer(&buf[0])
-	v := Value{typ: typ, val: ptr}
-
-	return v
+	n := int(typ.Size())
+	var ptr unsafe.Pointer
+	if n > 0 {
+		buf := make([]byte, n)
+		ptr = unsafe.Pointer(&buf[0])
+	} else {
+		// A zero-size type (e.g. an empty array backing an empty Go
+		// slice round-tripped through ValueOf) still needs a unique,
+		// non-nil, addressable pointer.
+		ptr = unsafe.Pointer(new(byte))
+	}
+	return Value{typ: typ, val: ptr, flag: kindFlag(typ.Kind())}
 }
 
 // NewAt returns a Value representing a pointer to a value of the specified
@@ -96,8 +111,7 @@ func NewAt(typ Type, p unsafe.Pointer) Value {
 	if err != nil {
 		return Value{}
 	}
-	v := Value{typ, p}
-	return v
+	return Value{typ, p, kindFlag(typ.Kind())}
 }
 
 // mustBe panics if v's kind is not expected.
@@ -108,16 +122,60 @@ func (v Value) mustBe(expected Kind) {
 	}
 }
 
+// mustBeAssignable panics with a ValueError naming the calling method if
+// v is read-only or not addressable.
+func (v Value) mustBeAssignable() {
+	if v.flag&flagRO != 0 {
+		panic(&ValueError{methodName(), v.Kind()})
+	}
+	if v.flag&flagAddr == 0 {
+		panic(&ValueError{methodName(), v.Kind()})
+	}
+}
+
+// mustBeExported panics if v was obtained via an unexported field.
+func (v Value) mustBeExported() {
+	if v.flag&flagRO != 0 {
+		panic(&ValueError{methodName(), v.Kind()})
+	}
+}
+
+// CanAddr reports whether v's value can be addressed with Addr.
+// Such values are called addressable. A value can be addressed if it is
+// an element of a slice, the result of dereferencing a pointer, or a
+// field of an addressable struct.
+func (v Value) CanAddr() bool {
+	return v.flag&flagAddr != 0
+}
+
+// CanSet reports whether v's value can be changed.
+// A Value can be changed only if it is addressable and was not obtained
+// through an unexported field.
+func (v Value) CanSet() bool {
+	return v.flag&(flagAddr|flagRO) == flagAddr
+}
+
+// CanInterface reports whether Interface can be used without panicking.
+func (v Value) CanInterface() bool {
+	return v.flag&flagRO == 0
+}
+
 // Addr returns a pointer value representing the address of v.
 // It panics if CanAddr() returns false.
 // Addr is typically used to obtain a pointer to a struct field.
 func (v Value) Addr() Value {
+	if !v.CanAddr() {
+		panic(&ValueError{"ffi.Value.Addr", v.Kind()})
+	}
 	typ := PtrTo(v.typ)
 	if typ == nil {
 		return Value{}
 	}
 	ptr := unsafe.Pointer(&v.val)
-	return Value{typ, ptr}
+	// Unlike New/NewAt, the resulting Value is not itself addressable:
+	// it's a fresh Ptr value pointing at v, not a field reachable from
+	// some other addressable root, so flagAddr must not be set.
+	return Value{typ, ptr, v.flag&flagRO | flag(Ptr)<<flagKindShift | flagIndir}
 }
 
 // Buffer returns the underlying byte storage for this value.
@@ -130,11 +188,93 @@ func (v Value) Buffer() []byte {
 	return buf
 }
 
+// Bool returns v's underlying value.
+// It panics if v's Kind is not Bool.
+func (v Value) Bool() bool {
+	v.mustBe(Bool)
+	return *(*bool)(v.val)
+}
+
+// SetBool sets v's underlying value.
+// It panics if v's Kind is not Bool, or if CanSet() is false.
+func (v Value) SetBool(x bool) {
+	v.mustBeAssignable()
+	v.mustBe(Bool)
+	*(*bool)(v.val) = x
+}
+
+// Bytes returns v's underlying value, which must be a Slice of Uint8
+// elements, as a []byte.
+// It panics if v's Kind is not Slice or its element Kind is not Uint8.
+func (v Value) Bytes() []byte {
+	v.mustBe(Slice)
+	if v.typ.Elem().Kind() != Uint8 {
+		panic(&ValueError{"ffi.Value.Bytes", v.Kind()})
+	}
+	hdr := (*sliceHeader)(v.val)
+	var b []byte
+	s := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	s.Data = uintptr(hdr.Data)
+	s.Len = int(hdr.Len)
+	s.Cap = int(hdr.Cap)
+	return b
+}
+
+// SetBytes sets v's underlying value, which must be a Slice of Uint8
+// elements, to a copy of x's header (the backing array is not copied).
+// It panics if v's Kind is not Slice or its element Kind is not Uint8,
+// or if CanSet() is false.
+func (v Value) SetBytes(x []byte) {
+	v.mustBeAssignable()
+	v.mustBe(Slice)
+	if v.typ.Elem().Kind() != Uint8 {
+		panic(&ValueError{"ffi.Value.SetBytes", v.Kind()})
+	}
+	s := (*reflect.SliceHeader)(unsafe.Pointer(&x))
+	hdr := (*sliceHeader)(v.val)
+	hdr.Data = unsafe.Pointer(s.Data)
+	hdr.Len = uintptr(s.Len)
+	hdr.Cap = uintptr(s.Cap)
+}
+
 // Cap returns v's capacity.
-// It panics if v's Kind is not Array.
+// It panics if v's Kind is not Array or Slice.
 func (v Value) Cap() int {
-	v.mustBe(Array)
-	return v.typ.Len()
+	switch v.Kind() {
+	case Array:
+		return v.typ.Len()
+	case Slice:
+		return int((*sliceHeader)(v.val).Cap)
+	}
+	panic(&ValueError{"ffi.Value.Cap", v.Kind()})
+}
+
+// Complex returns v's underlying value, as a complex128.
+// It panics if v's Kind is not Complex64 or Complex128.
+func (v Value) Complex() complex128 {
+	k := v.typ.Kind()
+	switch k {
+	case Complex64:
+		return complex128(*(*complex64)(v.val))
+	case Complex128:
+		return *(*complex128)(v.val)
+	}
+	panic(&ValueError{"ffi.Value.Complex", k})
+}
+
+// SetComplex sets v's underlying value to x.
+// It panics if v's Kind is not Complex64 or Complex128, or if CanSet()
+// is false.
+func (v Value) SetComplex(x complex128) {
+	v.mustBeAssignable()
+	switch k := v.typ.Kind(); k {
+	default:
+		panic(&ValueError{"ffi.Value.SetComplex", k})
+	case Complex64:
+		*(*complex64)(v.val) = complex64(x)
+	case Complex128:
+		*(*complex128)(v.val) = x
+	}
 }
 
 // Elem returns the value that the pointer v points to.
@@ -144,7 +284,8 @@ func (v Value) Elem() Value {
 	typ := v.typ.Elem()
 	val := v.val
 	val = *(*unsafe.Pointer)(val)
-	return Value{typ: typ, val: val}
+	fl := v.flag&flagRO | kindFlag(typ.Kind())
+	return Value{typ: typ, val: val, flag: fl}
 }
 
 // Field returns the i'th field of the struct v.
@@ -162,16 +303,21 @@ func (v Value) Field(i int) Value {
 	var val unsafe.Pointer
 	// Indirect.  Just bump pointer.
 	val = unsafe.Pointer(uintptr(v.val) + field.Offset)
-	return Value{typ, val}
+	fl := v.flag&(flagRO|flagAddr) | flagIndir | flag(typ.Kind())<<flagKindShift
+	return Value{typ, val, fl}
 }
 
 // FieldByIndex returns the nested field corresponding to index.
-// It panics if v's Kind is not struct.
+// It panics if v's Kind is not struct, or if it must traverse a nil
+// embedded pointer to reach the field.
 func (v Value) FieldByIndex(index []int) Value {
 	v.mustBe(Struct)
 	for i, x := range index {
 		if i > 0 {
-			if v.Kind() == Ptr && v.Elem().Kind() == Struct {
+			if v.Kind() == Ptr && v.typ.Elem().Kind() == Struct {
+				if v.IsNil() {
+					panic("ffi: FieldByIndex: nil pointer to embedded struct field")
+				}
 				v = v.Elem()
 			}
 		}
@@ -185,18 +331,83 @@ func (v Value) FieldByIndex(index []int) Value {
 // It panics if v's Kind is not struct.
 func (v Value) FieldByName(name string) Value {
 	v.mustBe(Struct)
-	for i := 0; i < v.typ.NumField(); i++ {
-		if v.typ.Field(i).Name == name {
-			return v.Field(i)
-		}
+	if index, ok := nameIndexFor(v.typ).m[name]; ok {
+		return v.FieldByIndex(index)
 	}
 	return Value{}
-	/*
-		if f, ok := v.typ.FieldByName(name); ok {
-			return v.FieldByIndex(f.Index)
+}
+
+// FieldByNameFunc returns the struct field with a name for which match
+// reports true. It returns the zero Value if no field matched, or if
+// more than one field matches.
+// It panics if v's Kind is not struct.
+func (v Value) FieldByNameFunc(match func(string) bool) Value {
+	v.mustBe(Struct)
+	found := -1
+	for i := 0; i < v.typ.NumField(); i++ {
+		if match(v.typ.Field(i).Name) {
+			if found >= 0 {
+				return Value{}
+			}
+			found = i
 		}
+	}
+	if found < 0 {
 		return Value{}
-	*/
+	}
+	return v.Field(found)
+}
+
+// nameIndex caches the name -> field index lookup for one Struct Type,
+// built at most once regardless of how many goroutines race to build it.
+type nameIndex struct {
+	once sync.Once
+	m    map[string][]int
+}
+
+var (
+	nameIndexCacheMu sync.Mutex
+	nameIndexCache   = make(map[string]*nameIndex)
+)
+
+// nameIndexFor returns the (lazily built) name index for t.
+func nameIndexFor(t Type) *nameIndex {
+	key := t.String()
+
+	nameIndexCacheMu.Lock()
+	ni, ok := nameIndexCache[key]
+	if !ok {
+		ni = &nameIndex{}
+		nameIndexCache[key] = ni
+	}
+	nameIndexCacheMu.Unlock()
+
+	ni.once.Do(func() {
+		m := make(map[string][]int)
+		appendNameIndex(t, nil, m)
+		ni.m = m
+	})
+	return ni
+}
+
+// appendNameIndex walks t's fields, recording each name's index path in
+// m, and recurses into anonymous (empty-Name) struct fields so a name
+// promoted from an embedded struct resolves the same way it does for
+// VisibleFields/appendVisibleFields.
+func appendNameIndex(t Type, prefix []int, m map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := make([]int, len(prefix)+1)
+		copy(index, prefix)
+		index[len(prefix)] = i
+
+		if _, dup := m[f.Name]; f.Name != "" && !dup {
+			m[f.Name] = index
+		}
+		if f.Name == "" && f.Type.Kind() == Struct {
+			appendNameIndex(f.Type, index, m)
+		}
+	}
 }
 
 // Float returns v's underlying value, as a float64.
@@ -212,19 +423,78 @@ func (v Value) Float() float64 {
 	panic(&ValueError{"ffi.Value.Float", k})
 }
 
+// sliceHeader is the C layout backing a Slice Value: a data pointer plus
+// a length and capacity, mirroring reflect.SliceHeader.
+type sliceHeader struct {
+	Data unsafe.Pointer
+	Len  uintptr
+	Cap  uintptr
+}
+
 // Index returns v's i'th element.
 // It panics if v's Kind is not Array or Slice or i is out of range.
 func (v Value) Index(i int) Value {
-	v.mustBe(Array)
-	tt := v.typ.(cffi_array)
-	if i < 0 || i > int(tt.Len()) {
-		panic("ffi: array index out of range")
+	switch v.Kind() {
+	case Array:
+		tt := v.typ.(cffi_array)
+		if i < 0 || i >= int(tt.Len()) {
+			panic("ffi: array index out of range")
+		}
+		typ := tt.Elem()
+		offset := uintptr(i) * typ.Size()
+		fl := v.flag&(flagRO|flagAddr) | flagIndir | flag(typ.Kind())<<flagKindShift
+		return Value{typ, unsafe.Pointer(uintptr(v.val) + offset), fl}
+	case Slice:
+		hdr := (*sliceHeader)(v.val)
+		if i < 0 || i >= int(hdr.Len) {
+			panic("ffi: slice index out of range")
+		}
+		typ := v.typ.Elem()
+		offset := uintptr(i) * typ.Size()
+		// Elements reached through a slice's data pointer are always
+		// addressable, regardless of whether the slice header itself is.
+		fl := v.flag&flagRO | kindFlag(typ.Kind())
+		return Value{typ, unsafe.Pointer(uintptr(hdr.Data) + offset), fl}
 	}
-	typ := tt.Elem()
-	offset := uintptr(i) * typ.Size()
+	panic(&ValueError{"ffi.Value.Index", v.Kind()})
+}
 
-	var val unsafe.Pointer = unsafe.Pointer(uintptr(v.val) + offset)
-	return Value{typ, val}
+// Slice returns v[i:j]. It panics if v's Kind is not Array or Slice, or
+// the indices are out of range.
+//
+// For an Array, v must be addressable.
+func (v Value) Slice(i, j int) Value {
+	switch v.Kind() {
+	case Array:
+		tt := v.typ.(cffi_array)
+		if i < 0 || j < i || j > int(tt.Len()) {
+			panic("ffi: slice index out of range")
+		}
+		elem := tt.Elem()
+		typ, err := NewSliceType(elem)
+		if err != nil {
+			panic("ffi: Slice: " + err.Error())
+		}
+		res := New(typ)
+		hdr := (*sliceHeader)(res.val)
+		hdr.Data = unsafe.Pointer(uintptr(v.val) + uintptr(i)*elem.Size())
+		hdr.Len = uintptr(j - i)
+		hdr.Cap = uintptr(int(tt.Len()) - i)
+		return res
+	case Slice:
+		hdr := (*sliceHeader)(v.val)
+		if i < 0 || j < i || j > int(hdr.Cap) {
+			panic("ffi: slice index out of range")
+		}
+		elem := v.typ.Elem()
+		res := New(v.typ)
+		rhdr := (*sliceHeader)(res.val)
+		rhdr.Data = unsafe.Pointer(uintptr(hdr.Data) + uintptr(i)*elem.Size())
+		rhdr.Len = uintptr(j - i)
+		rhdr.Cap = hdr.Cap - uintptr(i)
+		return res
+	}
+	panic(&ValueError{"ffi.Value.Slice", v.Kind()})
 }
 
 // Int returns v's underlying value, as an int64.
@@ -271,11 +541,16 @@ func (v Value) Kind() Kind {
 }
 
 // Len returns v's length.
-// It panics if v's Kind is not Array
+// It panics if v's Kind is not Array or Slice.
 func (v Value) Len() int {
-	v.mustBe(Array)
-	tt := v.typ.(cffi_array)
-	return int(tt.Len())
+	switch v.Kind() {
+	case Array:
+		tt := v.typ.(cffi_array)
+		return int(tt.Len())
+	case Slice:
+		return int((*sliceHeader)(v.val).Len)
+	}
+	panic(&ValueError{"ffi.Value.Len", v.Kind()})
 }
 
 // NumField returns the number of fields in the struct v.
@@ -288,6 +563,7 @@ func (v Value) NumField() int {
 // SetFloat sets v's underlying value to x.
 // It panics if v's Kind is not Float or Double, or if CanSet() is false.
 func (v Value) SetFloat(x float64) {
+	v.mustBeAssignable()
 	switch k := v.typ.Kind(); k {
 	default:
 		panic(&ValueError{"ffi.Value.SetFloat", k})
@@ -301,7 +577,7 @@ func (v Value) SetFloat(x float64) {
 // SetInt sets v's underlying value to x.
 // It panics if v's Kind is not Int, Int8, Int16, Int32, or Int64, or if CanSet() is false.
 func (v Value) SetInt(x int64) {
-	//v.mustBeAssignable()
+	v.mustBeAssignable()
 	switch k := v.typ.Kind(); k {
 	default:
 		panic(&ValueError{"ffi.Value.SetInt", k})
@@ -319,14 +595,15 @@ func (v Value) SetInt(x int64) {
 }
 
 // SetUint sets v's underlying value to x.
-// It panics if v's Kind is not Int, Int8, Int16, Int32, or Int64, or if CanSet() is false.
+// It panics if v's Kind is not Uint, Uintptr, Uint8, Uint16, Uint32, or
+// Uint64, or if CanSet() is false.
 func (v Value) SetUint(x uint64) {
-	//v.mustBeAssignable()
+	v.mustBeAssignable()
 	switch k := v.typ.Kind(); k {
 	default:
 		panic(&ValueError{"ffi.Value.SetUint", k})
-	// case Uint:
-	// 	*(*uint)(v.val) = uint(x)
+	case Uint:
+		*(*uint)(v.val) = uint(x)
 	case Uint8:
 		*(*uint8)(v.val) = uint8(x)
 	case Uint16:
@@ -335,6 +612,8 @@ func (v Value) SetUint(x uint64) {
 		*(*uint32)(v.val) = uint32(x)
 	case Uint64:
 		*(*uint64)(v.val) = x
+	case Uintptr:
+		*(*uintptr)(v.val) = uintptr(x)
 	}
 }
 
@@ -349,8 +628,8 @@ func (v Value) Uint() uint64 {
 	k := v.typ.Kind()
 	var p unsafe.Pointer = v.val
 	switch k {
-	// case Uint:
-	// 	return uint64(*(*uint)(p))
+	case Uint:
+		return uint64(*(*uint)(p))
 	case Uint8:
 		return uint64(*(*uint8)(p))
 	case Uint16:
@@ -359,12 +638,146 @@ func (v Value) Uint() uint64 {
 		return uint64(*(*uint32)(p))
 	case Uint64:
 		return uint64(*(*uint64)(p))
-		// case Uintptr:
-		// 	return uint64(*(*uintptr)(p))
+	case Uintptr:
+		return uint64(*(*uintptr)(p))
 	}
 	panic(&ValueError{"ffi.Value.Uint", k})
 }
 
+// String returns v's underlying value, as a Go string copied out of a
+// NUL-terminated char*.
+// It panics if v's Kind is not String.
+func (v Value) String() string {
+	v.mustBe(String)
+	p := *(*unsafe.Pointer)(v.val)
+	if p == nil {
+		return ""
+	}
+	n := 0
+	for *(*byte)(unsafe.Pointer(uintptr(p) + uintptr(n))) != 0 {
+		n++
+	}
+	buf := make([]byte, n)
+	for i := 0; i < n; i++ {
+		buf[i] = *(*byte)(unsafe.Pointer(uintptr(p) + uintptr(i)))
+	}
+	return string(buf)
+}
+
+// SetString sets v's underlying char* to point at a newly allocated
+// NUL-terminated copy of x.
+// It panics if v's Kind is not String, or if CanSet() is false.
+func (v Value) SetString(x string) {
+	v.mustBeAssignable()
+	v.mustBe(String)
+	buf := make([]byte, len(x)+1)
+	copy(buf, x)
+	*(*unsafe.Pointer)(v.val) = unsafe.Pointer(&buf[0])
+}
+
+// typeIdentical reports whether a and b describe the same type. Struct
+// Types carry a field list, which makes their underlying representation
+// uncomparable with ==, so identity is decided by Type.String() instead.
+func typeIdentical(a, b Type) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.String() == b.String()
+}
+
+// Set assigns x to v. It panics if CanSet() returns false, or if x's
+// type is not identical to v's type.
+func (v Value) Set(x Value) {
+	v.mustBeAssignable()
+	x.mustBeExported()
+	if !typeIdentical(v.typ, x.typ) {
+		panic("ffi: value of type " + x.typ.String() + " is not assignable to type " + v.typ.String())
+	}
+	n := int(v.typ.Size())
+	dst := unsafe.Slice((*byte)(v.val), n)
+	src := unsafe.Slice((*byte)(x.val), n)
+	copy(dst, src)
+}
+
+// SetPointer sets the unsafe.Pointer value v to x.
+// It panics if v's Kind is not Ptr, or if CanSet() is false.
+func (v Value) SetPointer(x unsafe.Pointer) {
+	v.mustBeAssignable()
+	v.mustBe(Ptr)
+	*(*unsafe.Pointer)(v.val) = x
+}
+
+// Pointer returns v's value as a uintptr.
+// It panics if v's Kind is not Ptr.
+func (v Value) Pointer() uintptr {
+	v.mustBe(Ptr)
+	return uintptr(*(*unsafe.Pointer)(v.val))
+}
+
+func isIntKind(k Kind) bool {
+	switch k {
+	case Int, Int8, Int16, Int32, Int64:
+		return true
+	}
+	return false
+}
+
+func isUintKind(k Kind) bool {
+	switch k {
+	case Uint, Uint8, Uint16, Uint32, Uint64, Uintptr:
+		return true
+	}
+	return false
+}
+
+func isFloatKind(k Kind) bool {
+	switch k {
+	case Float, Double:
+		return true
+	}
+	return false
+}
+
+// Convert returns the value v converted to type t.
+// It supports the same conversions between integer, unsigned integer,
+// and floating-point kinds that a Go type conversion does, plus
+// unsafe.Pointer <-> uintptr casts between Ptr and Uintptr kinds.
+// It panics if the conversion is not supported.
+func (v Value) Convert(t Type) Value {
+	if typeIdentical(v.typ, t) {
+		return v
+	}
+	sk, dk := v.Kind(), t.Kind()
+	r := New(t)
+	switch {
+	case isIntKind(sk) && isIntKind(dk):
+		r.SetInt(v.Int())
+	case isIntKind(sk) && isUintKind(dk):
+		r.SetUint(uint64(v.Int()))
+	case isIntKind(sk) && isFloatKind(dk):
+		r.SetFloat(float64(v.Int()))
+	case isUintKind(sk) && isUintKind(dk):
+		r.SetUint(v.Uint())
+	case isUintKind(sk) && isIntKind(dk):
+		r.SetInt(int64(v.Uint()))
+	case isUintKind(sk) && isFloatKind(dk):
+		r.SetFloat(float64(v.Uint()))
+	case isFloatKind(sk) && isFloatKind(dk):
+		r.SetFloat(v.Float())
+	case isFloatKind(sk) && isIntKind(dk):
+		r.SetInt(int64(v.Float()))
+	case isFloatKind(sk) && isUintKind(dk):
+		r.SetUint(uint64(v.Float()))
+	case sk == Ptr && dk == Uintptr:
+		r.SetUint(uint64(v.Pointer()))
+	case sk == Uintptr && dk == Ptr:
+		r.SetPointer(unsafe.Pointer(uintptr(v.Uint())))
+	default:
+		panic("ffi: value of type " + v.typ.String() + " cannot be converted to type " + t.String())
+	}
+	return r
+}
+
 // UnsafeAddr returns a pointer to v's data.
 // It is for advanced clients that also import the "unsafe" package.
 func (v Value) UnsafeAddr() uintptr {
@@ -385,4 +798,326 @@ func Indirect(v Value) Value {
 	return v.Elem()
 }
 
+// StructField describes a single field of a Struct Type, as derived from
+// the underlying C layout.
+type StructField struct {
+	Name   string
+	Type   Type
+	Offset uintptr
+
+	// Index is the field's index path as accepted by FieldByIndex: a
+	// single element for a direct field, or more when the field was
+	// promoted up through one or more anonymous (embedded) struct
+	// fields.
+	Index []int
+
+	// Tag holds whatever Go struct tag-style annotations, if any, the
+	// underlying Type attaches to the field. It is empty for fields
+	// parsed straight from a C declaration.
+	Tag reflect.StructTag
+}
+
+// VisibleFields returns all fields of Struct type t, including fields
+// promoted from anonymous (embedded) struct fields, so that callers can
+// enumerate the full set of accessible fields without reimplementing the
+// recursion themselves. Each returned StructField's Index is the path
+// FieldByIndex needs to reach it.
+//
+// It panics if t's Kind is not Struct.
+func VisibleFields(t Type) []StructField {
+	if t.Kind() != Struct {
+		panic(&ValueError{"ffi.VisibleFields", t.Kind()})
+	}
+	var out []StructField
+	appendVisibleFields(t, nil, &out)
+	return out
+}
+
+func appendVisibleFields(t Type, prefix []int, out *[]StructField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := make([]int, len(prefix)+1)
+		copy(index, prefix)
+		index[len(prefix)] = i
+		f.Index = index
+		*out = append(*out, f)
+
+		// C gives anonymous struct/union members an empty name; recurse
+		// into them so their fields are promoted like an embedded Go
+		// struct field's are.
+		if f.Name == "" && f.Type.Kind() == Struct {
+			appendVisibleFields(f.Type, index, out)
+		}
+	}
+}
+
+// Interface returns v's current value as an interface{}, materialized
+// into a Go value of an equivalent type (structs become anonymous Go
+// structs, one exported field per C field).
+func (v Value) Interface() interface{} {
+	rv := reflect.New(goTypeOf(v.typ)).Elem()
+	v.copyToGo(rv)
+	return rv.Interface()
+}
+
+// ValueOf returns a new Value of a C type derived from the type of i,
+// with i's data copied in. It is the inverse of Interface.
+func ValueOf(i interface{}) Value {
+	rv := reflect.ValueOf(i)
+	v := New(ffiTypeOf(rv.Type()))
+	v.copyFromGo(rv)
+	return v
+}
+
+// goTypeOf returns the Go type that Interface materializes a value of typ
+// into: the Go counterpart of each C kind (a C char* String becomes a Go
+// string, a Func a uintptr), filled in by copyToGo value by value.
+func goTypeOf(typ Type) reflect.Type {
+	switch k := typ.Kind(); k {
+	case Bool:
+		return reflect.TypeOf(false)
+	case Int:
+		return reflect.TypeOf(int(0))
+	case Int8:
+		return reflect.TypeOf(int8(0))
+	case Int16:
+		return reflect.TypeOf(int16(0))
+	case Int32:
+		return reflect.TypeOf(int32(0))
+	case Int64:
+		return reflect.TypeOf(int64(0))
+	case Uint:
+		return reflect.TypeOf(uint(0))
+	case Uint8:
+		return reflect.TypeOf(uint8(0))
+	case Uint16:
+		return reflect.TypeOf(uint16(0))
+	case Uint32:
+		return reflect.TypeOf(uint32(0))
+	case Uint64:
+		return reflect.TypeOf(uint64(0))
+	case Uintptr:
+		return reflect.TypeOf(uintptr(0))
+	case Float:
+		return reflect.TypeOf(float32(0))
+	case Double:
+		return reflect.TypeOf(float64(0))
+	case Complex64:
+		return reflect.TypeOf(complex64(0))
+	case Complex128:
+		return reflect.TypeOf(complex128(0))
+	case String:
+		return reflect.TypeOf("")
+	case Ptr:
+		return reflect.PtrTo(goTypeOf(typ.Elem()))
+	case Array:
+		tt := typ.(cffi_array)
+		return reflect.ArrayOf(int(tt.Len()), goTypeOf(tt.Elem()))
+	case Slice:
+		return reflect.SliceOf(goTypeOf(typ.Elem()))
+	case Func:
+		return reflect.TypeOf(uintptr(0))
+	case Struct:
+		tt := typ.(cffi_struct)
+		n := tt.NumField()
+		sfields := make([]reflect.StructField, n)
+		for i := 0; i < n; i++ {
+			f := tt.fields[i]
+			sfields[i] = reflect.StructField{
+				Name: exportedName(f.Name, i),
+				Type: goTypeOf(f.Type),
+			}
+		}
+		return reflect.StructOf(sfields)
+	default:
+		panic(&ValueError{"ffi.Value.Interface", k})
+	}
+}
+
+// ffiTypeOf returns the C type with the same memory layout as rt.
+func ffiTypeOf(rt reflect.Type) Type {
+	switch rt.Kind() {
+	case reflect.Bool:
+		return boolType
+	case reflect.Int:
+		return intType
+	case reflect.Int8:
+		return int8Type
+	case reflect.Int16:
+		return int16Type
+	case reflect.Int32:
+		return int32Type
+	case reflect.Int64:
+		return int64Type
+	case reflect.Uint:
+		return uintType
+	case reflect.Uint8:
+		return uint8Type
+	case reflect.Uint16:
+		return uint16Type
+	case reflect.Uint32:
+		return uint32Type
+	case reflect.Uint64:
+		return uint64Type
+	case reflect.Uintptr:
+		return uintptrType
+	case reflect.Float32:
+		return floatType
+	case reflect.Float64:
+		return doubleType
+	case reflect.Complex64:
+		return complex64Type
+	case reflect.Complex128:
+		return complex128Type
+	case reflect.String:
+		return stringType
+	case reflect.Ptr:
+		typ, err := NewPointerType(ffiTypeOf(rt.Elem()))
+		if err != nil {
+			panic("ffi: ValueOf: " + err.Error())
+		}
+		return typ
+	case reflect.Array:
+		typ, err := NewArrayType(ffiTypeOf(rt.Elem()), rt.Len())
+		if err != nil {
+			panic("ffi: ValueOf: " + err.Error())
+		}
+		return typ
+	case reflect.Slice:
+		typ, err := NewSliceType(ffiTypeOf(rt.Elem()))
+		if err != nil {
+			panic("ffi: ValueOf: " + err.Error())
+		}
+		return typ
+	case reflect.Struct:
+		n := rt.NumField()
+		fields := make([]StructField, n)
+		offset := uintptr(0)
+		for i := 0; i < n; i++ {
+			sf := rt.Field(i)
+			fields[i] = StructField{Name: sf.Name, Type: ffiTypeOf(sf.Type), Offset: offset}
+			offset += fields[i].Type.Size()
+		}
+		typ, err := NewStructType(fields)
+		if err != nil {
+			panic("ffi: ValueOf: " + err.Error())
+		}
+		return typ
+	default:
+		panic("ffi: ValueOf: unsupported Go kind " + rt.Kind().String())
+	}
+}
+
+// copyToGo copies v's C data into rv, a settable Go value of the type
+// returned by goTypeOf(v.typ).
+func (v Value) copyToGo(rv reflect.Value) {
+	switch v.Kind() {
+	case Bool:
+		rv.SetBool(v.Bool())
+	case Int, Int8, Int16, Int32, Int64:
+		rv.SetInt(v.Int())
+	case Uint, Uint8, Uint16, Uint32, Uint64, Uintptr:
+		rv.SetUint(v.Uint())
+	case Float, Double:
+		rv.SetFloat(v.Float())
+	case Complex64, Complex128:
+		rv.SetComplex(v.Complex())
+	case String:
+		rv.SetString(v.String())
+	case Ptr:
+		if v.IsNil() {
+			return
+		}
+		elem := reflect.New(rv.Type().Elem()).Elem()
+		v.Elem().copyToGo(elem)
+		rv.Set(elem.Addr())
+	case Array:
+		for i := 0; i < v.Len(); i++ {
+			v.Index(i).copyToGo(rv.Index(i))
+		}
+	case Slice:
+		n := v.Len()
+		rv.Set(reflect.MakeSlice(rv.Type(), n, n))
+		for i := 0; i < n; i++ {
+			v.Index(i).copyToGo(rv.Index(i))
+		}
+	case Func:
+		rv.SetUint(uint64(uintptr(*(*unsafe.Pointer)(v.val))))
+	case Struct:
+		for i := 0; i < v.NumField(); i++ {
+			v.Field(i).copyToGo(rv.Field(i))
+		}
+	default:
+		panic(&ValueError{"ffi.Value.Interface", v.Kind()})
+	}
+}
+
+// copyFromGo copies rv, a Go value of the type returned by
+// ffiTypeOf(rv.Type()), into v's C storage.
+func (v Value) copyFromGo(rv reflect.Value) {
+	switch v.Kind() {
+	case Bool:
+		v.SetBool(rv.Bool())
+	case Int, Int8, Int16, Int32, Int64:
+		v.SetInt(rv.Int())
+	case Uint, Uint8, Uint16, Uint32, Uint64, Uintptr:
+		v.SetUint(rv.Uint())
+	case Float, Double:
+		v.SetFloat(rv.Float())
+	case Complex64, Complex128:
+		v.SetComplex(rv.Complex())
+	case String:
+		v.SetString(rv.String())
+	case Ptr:
+		if rv.IsNil() {
+			return
+		}
+		elem := New(v.typ.Elem())
+		elem.copyFromGo(rv.Elem())
+		*(*unsafe.Pointer)(v.val) = elem.val
+	case Array:
+		for i := 0; i < v.Len(); i++ {
+			v.Index(i).copyFromGo(rv.Index(i))
+		}
+	case Slice:
+		n := rv.Len()
+		arrTyp, err := NewArrayType(v.typ.Elem(), n)
+		if err != nil {
+			panic("ffi: ValueOf: " + err.Error())
+		}
+		arr := New(arrTyp)
+		for i := 0; i < n; i++ {
+			arr.Index(i).copyFromGo(rv.Index(i))
+		}
+		hdr := (*sliceHeader)(v.val)
+		hdr.Data = arr.val
+		hdr.Len = uintptr(n)
+		hdr.Cap = uintptr(n)
+	case Func:
+		*(*unsafe.Pointer)(v.val) = unsafe.Pointer(uintptr(rv.Uint()))
+	case Struct:
+		for i := 0; i < v.NumField(); i++ {
+			v.Field(i).copyFromGo(rv.Field(i))
+		}
+	default:
+		panic("ffi: ValueOf: unsupported field kind " + v.Kind().String())
+	}
+}
+
+// exportedName returns an exported version of name, the C name of the
+// i'th field, suitable for use as a Go struct field name via
+// reflect.StructOf: a lowercase first letter is capitalized, and a name
+// that is empty (a C anonymous member) or does not start with an ASCII
+// letter is prefixed with "F" and i.
+func exportedName(name string, i int) string {
+	b := []byte(name)
+	if len(b) > 0 && b[0] >= 'a' && b[0] <= 'z' {
+		b[0] -= 'a' - 'A'
+	}
+	if len(b) == 0 || b[0] < 'A' || b[0] > 'Z' {
+		return "F" + strconv.Itoa(i) + string(b)
+	}
+	return string(b)
+}
+
 // EOF
\ No newline at end of file
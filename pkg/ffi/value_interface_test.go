@@ -0,0 +1,27 @@
+package ffi
+
+import "testing"
+
+func TestValueOfEmptySlice(t *testing.T) {
+	v := ValueOf([]byte(nil))
+	if v.Len() != 0 {
+		t.Fatalf("got len %d, want 0", v.Len())
+	}
+}
+
+func TestValueOfInterfaceRoundTrip(t *testing.T) {
+	cases := []interface{}{
+		true,
+		uint(7),
+		uintptr(42),
+		complex128(3 + 4i),
+		"hello",
+		[]int32{1, 2, 3},
+	}
+	for _, want := range cases {
+		got := ValueOf(want).Interface()
+		if !DeepEqual(ValueOf(got), ValueOf(want)) {
+			t.Errorf("round trip of %#v produced %#v", want, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package ffi
+
+import "testing"
+
+func TestBoolSetGet(t *testing.T) {
+	v := ValueOf(false)
+	v.SetBool(true)
+	if !v.Bool() {
+		t.Fatal("SetBool(true) did not stick")
+	}
+}
+
+func TestComplexSetGet(t *testing.T) {
+	v := ValueOf(complex128(0))
+	v.SetComplex(1 + 2i)
+	if v.Complex() != 1+2i {
+		t.Fatalf("got %v, want 1+2i", v.Complex())
+	}
+}
+
+func TestStringSetGet(t *testing.T) {
+	v := ValueOf("")
+	v.SetString("hello")
+	if v.String() != "hello" {
+		t.Fatalf("got %q, want %q", v.String(), "hello")
+	}
+}
+
+func TestBytesSetGet(t *testing.T) {
+	v := ValueOf([]byte(nil))
+	want := []byte{1, 2, 3}
+	v.SetBytes(want)
+	if string(v.Bytes()) != string(want) {
+		t.Fatalf("got %v, want %v", v.Bytes(), want)
+	}
+}
+
+func TestSliceRoundTrip(t *testing.T) {
+	want := []int32{1, 2, 3}
+	v := ValueOf(want)
+	if v.Len() != len(want) {
+		t.Fatalf("got len %d, want %d", v.Len(), len(want))
+	}
+	for i, x := range want {
+		if v.Index(i).Int() != int64(x) {
+			t.Fatalf("element %d: got %d, want %d", i, v.Index(i).Int(), x)
+		}
+	}
+}
+
+func TestArrayIndexOutOfRangePanics(t *testing.T) {
+	v := ValueOf([3]int32{1, 2, 3})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Index(3) on a length-3 array did not panic")
+		}
+	}()
+	v.Index(3)
+}